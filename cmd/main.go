@@ -1,23 +1,38 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
 
 	"github.com/seds-net/seds-agent/config"
+	"github.com/seds-net/seds-agent/configwatch"
 	"github.com/seds-net/seds-agent/grpc"
+	"github.com/seds-net/seds-agent/logging"
 	"github.com/seds-net/seds-agent/singbox"
 )
 
+// logSinkCapacity bounds how many log lines are buffered for forwarding to
+// the server between flushes.
+const logSinkCapacity = 1000
+
+// configWatchInterval is how often the config file is checked for changes.
+const configWatchInterval = 5 * time.Second
+
 var (
 	configPath  = flag.String("config", "config.yaml", "Path to configuration file")
 	genConfig   = flag.Bool("gen-config", false, "Generate example configuration file")
 	server      = flag.String("server", "", "Override server address (host:port)")
 	token       = flag.String("token", "", "Override authentication token")
 	singboxPath = flag.String("singbox", "", "Override sing-box executable path")
+	insecure    = flag.Bool("insecure", false, "Disable mTLS and connect with a plaintext channel (development only)")
 	version     = "dev"
 )
 
@@ -36,6 +51,11 @@ func main() {
 		return
 	}
 
+	// Record command-line flag overrides before the first Load so they're
+	// also re-applied by every subsequent Reload triggered by the config
+	// watcher (see applyOverrides in the config package).
+	config.SetOverrides(*server, *token, *singboxPath, *insecure)
+
 	// Load configuration
 	if err := config.Load(*configPath); err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -43,17 +63,6 @@ func main() {
 
 	cfg := config.Get()
 
-	// Override with command-line flags
-	if *server != "" {
-		cfg.Server = *server
-	}
-	if *token != "" {
-		cfg.Token = *token
-	}
-	if *singboxPath != "" {
-		cfg.SingBoxPath = *singboxPath
-	}
-
 	// Validate required configuration
 	if cfg.Server == "" {
 		log.Fatal("Server address is required (set in config or use -server flag)")
@@ -62,15 +71,28 @@ func main() {
 		log.Fatal("Authentication token is required (set in config or use -token flag)")
 	}
 
-	log.Printf("Server: %s", cfg.Server)
-	log.Printf("Config directory: %s", cfg.ConfigDir)
-	log.Printf("Sing-box path: %s", cfg.SingBoxPath)
+	logSink := logging.NewSink(logSinkCapacity)
+	appLogger := hclog.New(&hclog.LoggerOptions{
+		Name:       "agent",
+		Level:      hclog.LevelFromString(cfg.LogLevel),
+		JSONFormat: cfg.LogFormat == "json",
+		Output:     io.MultiWriter(os.Stdout, logSink),
+	})
+
+	appLogger.Info("starting agent", "server", cfg.Server, "config_dir", cfg.ConfigDir, "singbox_path", cfg.SingBoxPath)
 
 	// Initialize sing-box manager
-	sbManager := singbox.NewManager(cfg.SingBoxPath, cfg.ConfigDir)
+	sbManager := singbox.NewManager(cfg.SingBoxPath, cfg.ConfigDir, appLogger.Named("singbox"))
 
 	// Initialize gRPC client
-	client := grpc.NewClient(sbManager)
+	client := grpc.NewClient(sbManager, appLogger.Named("grpc"), logSink)
+
+	// Watch the config file and apply changes without restarting the process.
+	watchCtx, cancelWatch := context.WithCancel(context.Background())
+	watcher := configwatch.New(*configPath, configWatchInterval, appLogger.Named("configwatch"))
+	go watcher.Start(watchCtx, func(_, newCfg *config.Config, d configwatch.Diff) {
+		applyConfigChange(appLogger, sbManager, client, newCfg, d)
+	})
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
@@ -78,25 +100,61 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("Shutting down...")
+		appLogger.Info("shutting down")
+
+		cancelWatch()
 
 		// Stop sing-box
 		if sbManager.IsRunning() {
 			if err := sbManager.Stop(); err != nil {
-				log.Printf("Error stopping sing-box: %v", err)
+				appLogger.Error("failed to stop sing-box", "error", err)
 			}
 		}
 
 		// Close gRPC connection
 		if err := client.Close(); err != nil {
-			log.Printf("Error closing client: %v", err)
+			appLogger.Error("failed to close client", "error", err)
 		}
 
 		os.Exit(0)
 	}()
 
-	log.Println("Starting agent...")
-
 	// Run client (with auto-reconnection)
 	client.Run()
 }
+
+// applyConfigChange reacts to a reloaded configuration. Fields that can be
+// applied live are pushed straight to the relevant subsystem; fields that
+// require tearing down the connection or the sing-box process trigger that
+// instead.
+func applyConfigChange(logger hclog.Logger, sbManager *singbox.Manager, client *grpc.Client, newCfg *config.Config, d configwatch.Diff) {
+	for _, field := range d.Changed {
+		switch field {
+		case "LogLevel":
+			logger.SetLevel(hclog.LevelFromString(newCfg.LogLevel))
+		case "LogFormat":
+			logger.Warn("log_format changed on disk; restart the agent for it to take effect")
+		case "HeartbeatIntervalSeconds":
+			client.SetHeartbeatInterval(time.Duration(newCfg.HeartbeatIntervalSeconds) * time.Second)
+		case "StatsIntervalSeconds":
+			client.SetStatsInterval(time.Duration(newCfg.StatsIntervalSeconds) * time.Second)
+		case "ClashAPIPollIntervalSeconds":
+			sbManager.SetClashAPIPollInterval(time.Duration(newCfg.ClashAPIPollIntervalSeconds) * time.Second)
+		}
+	}
+
+	if d.SingBoxPathChanged {
+		logger.Info("singbox_path changed; restarting sing-box", "path", newCfg.SingBoxPath)
+		sbManager.SetExecPath(newCfg.SingBoxPath)
+		if sbManager.IsRunning() {
+			if err := sbManager.Restart(); err != nil {
+				logger.Error("failed to restart sing-box after config change", "error", err)
+			}
+		}
+	}
+
+	if d.NeedsReconnect {
+		logger.Info("configuration change requires reconnect")
+		client.TriggerReconnect()
+	}
+}
@@ -0,0 +1,227 @@
+// Package config loads and holds the agent's configuration. Callers read
+// the current configuration through Get, which returns an atomically
+// swapped snapshot so a concurrent Reload can never hand back a partially
+// updated struct.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the agent's full configuration, as loaded from config.yaml and
+// overridden by command-line flags.
+type Config struct {
+	// Server is the host:port of the control server.
+	Server string `yaml:"server"`
+	// Token is the bootstrap authentication token. Once the server rotates
+	// it, the rotated token on disk (TokenPath) takes precedence.
+	Token string `yaml:"token"`
+	// TokenPath is where a server-rotated token is persisted.
+	TokenPath string `yaml:"token_path"`
+
+	// SingBoxPath is the path to the sing-box executable.
+	SingBoxPath string `yaml:"singbox_path"`
+	// ConfigDir is where sing-box's own config.json (and related state) is
+	// written.
+	ConfigDir string `yaml:"config_dir"`
+
+	// LogLevel is the hclog level name (trace, debug, info, warn, error).
+	LogLevel string `yaml:"log_level"`
+	// LogFormat is either "text" or "json".
+	LogFormat string `yaml:"log_format"`
+
+	// Insecure disables mTLS. Development only.
+	Insecure bool `yaml:"insecure"`
+	// CACertPath, ClientCertPath and ClientKeyPath locate the mTLS material
+	// used to authenticate to the server and verify its certificate.
+	CACertPath     string `yaml:"ca_cert_path"`
+	ClientCertPath string `yaml:"client_cert_path"`
+	ClientKeyPath  string `yaml:"client_key_path"`
+	// ServerName is the SNI / certificate name to verify against.
+	ServerName string `yaml:"server_name"`
+	// AllowedSPIFFEIDs, if non-empty, restricts the accepted server
+	// certificates to those carrying one of these SPIFFE URI SANs.
+	AllowedSPIFFEIDs []string `yaml:"allowed_spiffe_ids"`
+
+	// AllowedCommands is the glob allowlist for the shell command executor.
+	AllowedCommands []string `yaml:"allowed_commands"`
+
+	// HeartbeatIntervalSeconds, StatsIntervalSeconds and
+	// ClashAPIPollIntervalSeconds are hot-reloadable without a reconnect.
+	HeartbeatIntervalSeconds    int `yaml:"heartbeat_interval_seconds"`
+	StatsIntervalSeconds        int `yaml:"stats_interval_seconds"`
+	ClashAPIPollIntervalSeconds int `yaml:"clash_api_poll_interval_seconds"`
+}
+
+var current atomic.Value // holds *Config
+
+// flagOverrides holds the command-line flag overrides set via SetOverrides.
+// They're re-applied on every Load/Reload so a hot reload triggered by an
+// unrelated on-disk edit doesn't silently discard them.
+var flagOverrides atomic.Value // holds overrides
+
+// overrides mirrors the subset of Config that can be overridden by
+// command-line flags. A zero value for a field means "not overridden."
+type overrides struct {
+	Server      string
+	Token       string
+	SingBoxPath string
+	Insecure    bool
+}
+
+// SetOverrides records command-line flag overrides to be applied on top of
+// every Load/Reload, so they survive config-file hot reloads. Call it before
+// the first Load.
+func SetOverrides(server, token, singBoxPath string, insecure bool) {
+	flagOverrides.Store(overrides{
+		Server:      server,
+		Token:       token,
+		SingBoxPath: singBoxPath,
+		Insecure:    insecure,
+	})
+}
+
+func applyOverrides(cfg *Config) {
+	o, ok := flagOverrides.Load().(overrides)
+	if !ok {
+		return
+	}
+	if o.Server != "" {
+		cfg.Server = o.Server
+	}
+	if o.Token != "" {
+		cfg.Token = o.Token
+	}
+	if o.SingBoxPath != "" {
+		cfg.SingBoxPath = o.SingBoxPath
+	}
+	if o.Insecure {
+		cfg.Insecure = true
+	}
+}
+
+// defaults returns a Config pre-populated with the same defaults that
+// GenerateExample writes out, except singbox_path and allowed_commands: those
+// have no default here, and the values GenerateExample writes for them are
+// examples only.
+func defaults() *Config {
+	const configDir = "state"
+
+	return &Config{
+		TokenPath:                   filepath.Join(configDir, "token"),
+		ConfigDir:                   configDir,
+		LogLevel:                    "info",
+		LogFormat:                   "text",
+		CACertPath:                  filepath.Join(configDir, "tls", "ca.pem"),
+		ClientCertPath:              filepath.Join(configDir, "tls", "client.pem"),
+		ClientKeyPath:               filepath.Join(configDir, "tls", "client-key.pem"),
+		HeartbeatIntervalSeconds:    30,
+		StatsIntervalSeconds:        30,
+		ClashAPIPollIntervalSeconds: 2,
+	}
+}
+
+// Load reads and parses the YAML configuration file at path and makes it
+// the current configuration.
+func Load(path string) error {
+	cfg, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+	return nil
+}
+
+// Reload re-reads path and replaces the current configuration. It's
+// intended for callers that want to diff the result against the previous
+// Get() themselves (see the config watcher).
+func Reload(path string) (*Config, error) {
+	cfg, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(cfg)
+	return cfg, nil
+}
+
+func readFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := defaults()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	applyOverrides(cfg)
+	clampNonPositiveIntervals(cfg)
+
+	return cfg, nil
+}
+
+// clampNonPositiveIntervals resets any interval field an operator configured
+// as zero or negative back to its default. grpc.Client falls back to its own
+// defaults for such intervals, but the Clash API poller passes its interval
+// straight to time.NewTicker, which panics on a non-positive duration.
+func clampNonPositiveIntervals(cfg *Config) {
+	d := defaults()
+	if cfg.HeartbeatIntervalSeconds <= 0 {
+		cfg.HeartbeatIntervalSeconds = d.HeartbeatIntervalSeconds
+	}
+	if cfg.StatsIntervalSeconds <= 0 {
+		cfg.StatsIntervalSeconds = d.StatsIntervalSeconds
+	}
+	if cfg.ClashAPIPollIntervalSeconds <= 0 {
+		cfg.ClashAPIPollIntervalSeconds = d.ClashAPIPollIntervalSeconds
+	}
+}
+
+// Get returns a snapshot of the current configuration. The returned pointer
+// is never mutated in place; a Reload swaps in a new one, so callers that
+// hold on to a previously returned pointer keep seeing a consistent view.
+func Get() *Config {
+	cfg, _ := current.Load().(*Config)
+	if cfg == nil {
+		return defaults()
+	}
+	return cfg
+}
+
+// GenerateExample writes a commented example configuration file to path.
+func GenerateExample(path string) error {
+	example := `# seds-agent configuration
+
+server: "" # host:port of the control server
+token: ""  # bootstrap authentication token
+token_path: state/token
+
+singbox_path: /usr/local/bin/sing-box
+config_dir: state
+
+log_level: info   # trace, debug, info, warn, error
+log_format: text  # text or json
+
+insecure: false
+ca_cert_path: state/tls/ca.pem
+client_cert_path: state/tls/client.pem
+client_key_path: state/tls/client-key.pem
+server_name: ""
+allowed_spiffe_ids: []
+
+allowed_commands:
+  - "singbox *"
+  - "logs *"
+
+heartbeat_interval_seconds: 30
+stats_interval_seconds: 30
+clash_api_poll_interval_seconds: 2
+`
+	return os.WriteFile(path, []byte(example), 0644)
+}
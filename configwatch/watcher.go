@@ -0,0 +1,165 @@
+// Package configwatch reloads the agent's configuration file without
+// requiring a process restart.
+package configwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/seds-net/seds-agent/config"
+)
+
+// Diff describes what changed between two configuration snapshots.
+type Diff struct {
+	// Changed lists the names of every top-level field that differs.
+	Changed []string
+	// NeedsReconnect is true if a field that requires tearing down and
+	// re-establishing the gRPC connection changed (server address, TLS
+	// material, token path, etc).
+	NeedsReconnect bool
+	// SingBoxPathChanged is true if SingBoxPath changed, which requires a
+	// controlled sing-box restart to take effect.
+	SingBoxPathChanged bool
+}
+
+// reconnectFields are the Config field names that require a reconnect
+// rather than an in-place update.
+var reconnectFields = map[string]bool{
+	"Server":           true,
+	"Insecure":         true,
+	"CACertPath":       true,
+	"ClientCertPath":   true,
+	"ClientKeyPath":    true,
+	"ServerName":       true,
+	"AllowedSPIFFEIDs": true,
+	"TokenPath":        true,
+}
+
+// diff compares two Config snapshots field by field using reflection, so a
+// newly added field is covered automatically instead of silently ignored.
+func diff(oldCfg, newCfg *config.Config) Diff {
+	var d Diff
+
+	oldVal := reflect.ValueOf(*oldCfg)
+	newVal := reflect.ValueOf(*newCfg)
+	t := oldVal.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if !reflect.DeepEqual(oldVal.Field(i).Interface(), newVal.Field(i).Interface()) {
+			d.Changed = append(d.Changed, name)
+			if reconnectFields[name] {
+				d.NeedsReconnect = true
+			}
+			if name == "SingBoxPath" {
+				d.SingBoxPathChanged = true
+			}
+		}
+	}
+
+	return d
+}
+
+// Watcher periodically stats the configuration file and reloads it when its
+// modification time has changed and its content hash differs from the last
+// one seen. A content change that leaves the modification time unchanged is
+// not picked up.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	logger   hclog.Logger
+
+	lastModTime time.Time
+	lastHash    [sha256.Size]byte
+}
+
+// New creates a Watcher for path, polling every interval.
+func New(path string, interval time.Duration, logger hclog.Logger) *Watcher {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	return &Watcher{path: path, interval: interval, logger: logger}
+}
+
+// Start blocks, polling until ctx is cancelled. Each time the file changes,
+// it reloads the configuration and invokes onChange with the old snapshot,
+// the new snapshot, and a Diff describing what changed. onChange is called
+// from the watcher's own goroutine, so it must not block for long.
+func (w *Watcher) Start(ctx context.Context, onChange func(oldCfg, newCfg *config.Config, d Diff)) {
+	// Seed lastModTime/lastHash from the file on disk so the first poll
+	// doesn't immediately fire a spurious reload.
+	if info, err := os.Stat(w.path); err == nil {
+		w.lastModTime = info.ModTime()
+	}
+	if hash, err := hashFile(w.path); err == nil {
+		w.lastHash = hash
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll(onChange)
+		}
+	}
+}
+
+func (w *Watcher) poll(onChange func(oldCfg, newCfg *config.Config, d Diff)) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		w.logger.Warn("failed to stat config file", "path", w.path, "error", err)
+		return
+	}
+
+	if info.ModTime().Equal(w.lastModTime) {
+		return
+	}
+
+	hash, err := hashFile(w.path)
+	if err != nil {
+		w.logger.Warn("failed to hash config file", "path", w.path, "error", err)
+		return
+	}
+
+	w.lastModTime = info.ModTime()
+	if hash == w.lastHash {
+		// Touched but not actually changed.
+		return
+	}
+	w.lastHash = hash
+
+	oldCfg := config.Get()
+	newCfg, err := config.Reload(w.path)
+	if err != nil {
+		w.logger.Error("failed to reload config", "error", err)
+		return
+	}
+
+	d := diff(oldCfg, newCfg)
+	if len(d.Changed) == 0 {
+		return
+	}
+
+	w.logger.Info("configuration changed on disk", "fields", d.Changed, "needs_reconnect", d.NeedsReconnect)
+	onChange(oldCfg, newCfg, d)
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sum, err
+	}
+
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,79 @@
+package configwatch
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/seds-net/seds-agent/config"
+)
+
+func TestDiffNoChanges(t *testing.T) {
+	cfg := &config.Config{Server: "example:443", LogLevel: "info"}
+	d := diff(cfg, cfg)
+	if len(d.Changed) != 0 {
+		t.Fatalf("got changed fields %v, want none", d.Changed)
+	}
+	if d.NeedsReconnect || d.SingBoxPathChanged {
+		t.Fatalf("got %+v, want no reconnect or singbox-path change", d)
+	}
+}
+
+func TestDiffReconnectField(t *testing.T) {
+	oldCfg := &config.Config{Server: "old:443"}
+	newCfg := &config.Config{Server: "new:443"}
+
+	d := diff(oldCfg, newCfg)
+
+	if !d.NeedsReconnect {
+		t.Errorf("changing Server should require a reconnect")
+	}
+	if !reflect.DeepEqual(d.Changed, []string{"Server"}) {
+		t.Errorf("Changed = %v, want [Server]", d.Changed)
+	}
+}
+
+func TestDiffSingBoxPathField(t *testing.T) {
+	oldCfg := &config.Config{SingBoxPath: "/usr/bin/sing-box"}
+	newCfg := &config.Config{SingBoxPath: "/usr/local/bin/sing-box"}
+
+	d := diff(oldCfg, newCfg)
+
+	if d.NeedsReconnect {
+		t.Errorf("SingBoxPath alone should not require a reconnect")
+	}
+	if !d.SingBoxPathChanged {
+		t.Errorf("changing SingBoxPath should set SingBoxPathChanged")
+	}
+}
+
+func TestDiffNonReconnectField(t *testing.T) {
+	oldCfg := &config.Config{StatsIntervalSeconds: 30}
+	newCfg := &config.Config{StatsIntervalSeconds: 60}
+
+	d := diff(oldCfg, newCfg)
+
+	if d.NeedsReconnect {
+		t.Errorf("StatsIntervalSeconds alone should not require a reconnect")
+	}
+	if !reflect.DeepEqual(d.Changed, []string{"StatsIntervalSeconds"}) {
+		t.Errorf("Changed = %v, want [StatsIntervalSeconds]", d.Changed)
+	}
+}
+
+func TestDiffMultipleFields(t *testing.T) {
+	oldCfg := &config.Config{Server: "old:443", LogLevel: "info", Token: "same"}
+	newCfg := &config.Config{Server: "new:443", LogLevel: "debug", Token: "same"}
+
+	d := diff(oldCfg, newCfg)
+
+	got := append([]string(nil), d.Changed...)
+	sort.Strings(got)
+	want := []string{"LogLevel", "Server"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Changed = %v, want %v", got, want)
+	}
+	if !d.NeedsReconnect {
+		t.Errorf("Server changed, so NeedsReconnect should be true")
+	}
+}
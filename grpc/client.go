@@ -4,35 +4,136 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
+
 	"github.com/seds-net/seds-agent/config"
+	"github.com/seds-net/seds-agent/logging"
 	"github.com/seds-net/seds-agent/proto"
 	"github.com/seds-net/seds-agent/singbox"
+	"github.com/seds-net/seds-agent/singbox/clashapi"
 	"github.com/seds-net/seds-agent/stats"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+// logFlushInterval is how often buffered log lines are drained and shipped
+// to the server.
+const logFlushInterval = 2 * time.Second
+
+// defaultHeartbeatInterval and defaultStatsInterval back-stop the ticker
+// construction in sendHeartbeat/sendStats in case a non-positive interval
+// ever reaches here; config.Load is expected to reject or clamp those
+// before this point, but time.NewTicker panics on a non-positive duration
+// and that must never take down the whole agent.
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultStatsInterval     = 30 * time.Second
+)
+
+// positiveOrDefault returns d if it's positive, or fallback otherwise.
+func positiveOrDefault(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
 // Client represents the gRPC client
 type Client struct {
 	conn           *grpc.ClientConn
 	stream         proto.AgentService_ConnectClient
 	sbManager      *singbox.Manager
 	statsCollector *stats.Collector
+	logger         hclog.Logger
+	logSink        *logging.Sink
 	ctx            context.Context
 	cancel         context.CancelFunc
+
+	tokenMu sync.RWMutex
+	token   string
+
+	heartbeatInterval atomic.Int64 // nanoseconds, written via SetHeartbeatInterval
+	statsInterval     atomic.Int64 // nanoseconds, written via SetStatsInterval
+
+	executors  map[string]Executor
+	commandsMu sync.Mutex
+	commands   map[string]context.CancelFunc
+
+	// sendMu serializes every send on stream: grpc-go forbids calling
+	// SendMsg concurrently from more than one goroutine, and heartbeats,
+	// stats, logs and (potentially several concurrent) commands all send
+	// on the same stream from their own goroutines.
+	sendMu sync.Mutex
 }
 
-// NewClient creates a new gRPC client
-func NewClient(sbManager *singbox.Manager) *Client {
+// NewClient creates a new gRPC client. logSink may be nil, in which case no
+// log entries are forwarded to the server.
+func NewClient(sbManager *singbox.Manager, logger hclog.Logger, logSink *logging.Sink) *Client {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Client{
+
+	cfg := config.Get()
+	token := cfg.Token
+	if rotated, err := loadToken(cfg.TokenPath); err != nil {
+		logger.Warn("failed to load rotated token, falling back to bootstrap token", "error", err)
+	} else if rotated != "" {
+		token = rotated
+	}
+
+	c := &Client{
 		sbManager:      sbManager,
-		statsCollector: stats.NewCollector(),
+		statsCollector: stats.NewCollector(logger.Named("stats")),
+		logger:         logger,
+		logSink:        logSink,
 		ctx:            ctx,
 		cancel:         cancel,
+		token:          token,
+		commands:       make(map[string]context.CancelFunc),
+	}
+	c.executors = buildExecutors(sbManager)
+	c.heartbeatInterval.Store(int64(time.Duration(cfg.HeartbeatIntervalSeconds) * time.Second))
+	c.statsInterval.Store(int64(time.Duration(cfg.StatsIntervalSeconds) * time.Second))
+
+	return c
+}
+
+// SetHeartbeatInterval changes how often heartbeats are sent. It takes
+// effect on the next tick, without requiring a reconnect.
+func (c *Client) SetHeartbeatInterval(d time.Duration) {
+	c.heartbeatInterval.Store(int64(d))
+}
+
+// SetStatsInterval changes how often system stats and sing-box status are
+// collected and sent. It takes effect on the next tick, without requiring a
+// reconnect.
+func (c *Client) SetStatsInterval(d time.Duration) {
+	c.statsInterval.Store(int64(d))
+}
+
+// currentToken returns the token currently used to authenticate, which may
+// be a server-rotated token rather than the bootstrap token from config.
+func (c *Client) currentToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.token
+}
+
+// setToken updates the in-memory token and persists it to disk so future
+// reconnects (including after a process restart) use the rotated value.
+func (c *Client) setToken(token string) {
+	c.tokenMu.Lock()
+	c.token = token
+	c.tokenMu.Unlock()
+
+	cfg := config.Get()
+	if err := saveTokenAtomic(cfg.TokenPath, token); err != nil {
+		c.logger.Error("failed to persist rotated token", "error", err)
 	}
 }
 
@@ -40,7 +141,18 @@ func NewClient(sbManager *singbox.Manager) *Client {
 func (c *Client) Connect() error {
 	cfg := config.Get()
 
-	log.Printf("Connecting to server: %s", cfg.Server)
+	c.logger.Info("connecting to server", "server", cfg.Server)
+
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		tlsCreds, err := buildTransportCredentials(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to build TLS credentials: %w", err)
+		}
+		creds = tlsCreds
+	} else {
+		c.logger.Warn("running with -insecure; gRPC channel is not encrypted or authenticated")
+	}
 
 	// Dial server
 	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
@@ -49,7 +161,7 @@ func (c *Client) Connect() error {
 	conn, err := grpc.DialContext(
 		ctx,
 		cfg.Server,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		grpc.WithBlock(),
 	)
 	if err != nil {
@@ -77,30 +189,42 @@ func (c *Client) Connect() error {
 	// Start message handlers
 	go c.receiveMessages()
 	go c.sendHeartbeat()
+	go c.sendStats()
+	if c.logSink != nil {
+		go c.sendLogs()
+	}
 
-	log.Println("Connected and registered successfully")
+	c.logger.Info("connected and registered successfully")
 	return nil
 }
 
 // register sends registration message to server
 func (c *Client) register() error {
-	cfg := config.Get()
-
 	msg := &proto.AgentMessage{
 		Payload: &proto.AgentMessage_Register{
 			Register: &proto.RegisterRequest{
-				Token:   cfg.Token,
+				Token:   c.currentToken(),
 				Version: "1.0.0",
 			},
 		},
 	}
 
+	return c.send(msg)
+}
+
+// send serializes writes to stream. grpc-go's ClientStream forbids calling
+// SendMsg from more than one goroutine at a time (Send concurrent with Recv
+// is the only safe combination), and heartbeats, stats, logs and commands
+// all send on this stream from their own goroutines.
+func (c *Client) send(msg *proto.AgentMessage) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
 	return c.stream.Send(msg)
 }
 
 // sendHeartbeat periodically sends heartbeat messages
 func (c *Client) sendHeartbeat() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(positiveOrDefault(time.Duration(c.heartbeatInterval.Load()), defaultHeartbeatInterval))
 	defer ticker.Stop()
 
 	for {
@@ -108,13 +232,10 @@ func (c *Client) sendHeartbeat() {
 		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
-			// Collect system stats
-			sysStats, err := c.statsCollector.Collect()
-			if err != nil {
-				log.Printf("Warning: failed to collect stats: %v", err)
+			if d := time.Duration(c.heartbeatInterval.Load()); d > 0 {
+				ticker.Reset(d)
 			}
 
-			// Send heartbeat with system stats
 			msg := &proto.AgentMessage{
 				Payload: &proto.AgentMessage_Heartbeat{
 					Heartbeat: &proto.Heartbeat{
@@ -123,13 +244,37 @@ func (c *Client) sendHeartbeat() {
 				},
 			}
 
-			if err := c.stream.Send(msg); err != nil {
-				log.Printf("Failed to send heartbeat: %v", err)
+			if err := c.send(msg); err != nil {
+				c.logger.Error("failed to send heartbeat", "error", err)
 				c.cancel() // Trigger reconnection
 				return
 			}
+		}
+	}
+}
+
+// sendStats periodically collects and sends system stats and sing-box
+// status. It runs on its own ticker so StatsIntervalSeconds can be tuned
+// independently of the heartbeat cadence.
+func (c *Client) sendStats() {
+	ticker := time.NewTicker(positiveOrDefault(time.Duration(c.statsInterval.Load()), defaultStatsInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if d := time.Duration(c.statsInterval.Load()); d > 0 {
+				ticker.Reset(d)
+			}
+
+			// Collect system stats
+			sysStats, err := c.statsCollector.Collect()
+			if err != nil {
+				c.logger.Warn("failed to collect stats", "error", err)
+			}
 
-			// Send system stats
 			if sysStats != nil {
 				var statsMap map[string]interface{}
 				json.Unmarshal(sysStats, &statsMap)
@@ -146,8 +291,8 @@ func (c *Client) sendHeartbeat() {
 					},
 				}
 
-				if err := c.stream.Send(statsMsg); err != nil {
-					log.Printf("Failed to send stats: %v", err)
+				if err := c.send(statsMsg); err != nil {
+					c.logger.Error("failed to send stats", "error", err)
 				}
 			}
 
@@ -156,16 +301,64 @@ func (c *Client) sendHeartbeat() {
 			statusMsg := &proto.AgentMessage{
 				Payload: &proto.AgentMessage_SbStatus{
 					SbStatus: &proto.SbStatus{
-						Running:     sbStatus.Running,
-						Connections: 0, // TODO: Implement connection tracking
-						Upload:      0, // TODO: Implement traffic tracking
-						Download:    0, // TODO: Implement traffic tracking
+						Running:        sbStatus.Running,
+						Connections:    sbStatus.Connections,
+						Upload:         sbStatus.Upload,
+						Download:       sbStatus.Download,
+						State:          sbStatus.State,
+						RetryCount:     int32(sbStatus.RetryCount),
+						LastExitReason: sbStatus.LastExitReason,
+						PerOutbound:    convertOutboundStats(sbStatus.PerOutbound),
+						PerRule:        convertOutboundStats(sbStatus.PerRule),
 					},
 				},
 			}
 
-			if err := c.stream.Send(statusMsg); err != nil {
-				log.Printf("Failed to send sing-box status: %v", err)
+			if err := c.send(statusMsg); err != nil {
+				c.logger.Error("failed to send sing-box status", "error", err)
+			}
+		}
+	}
+}
+
+// sendLogs periodically drains the log sink and streams buffered entries to
+// the server. It never blocks on backpressure from the sing-box monitor or
+// heartbeat goroutines: the sink itself drops the oldest entries when full.
+// A failed send ends forwarding for this connection and discards the rest of
+// that batch; the sink keeps buffering, and the sendLogs started by the next
+// Connect drains whatever it holds by then.
+func (c *Client) sendLogs() {
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			entries, dropped := c.logSink.Drain()
+			if len(entries) == 0 && dropped == 0 {
+				continue
+			}
+
+			for _, entry := range entries {
+				msg := &proto.AgentMessage{
+					Payload: &proto.AgentMessage_LogEntry{
+						LogEntry: &proto.LogEntry{
+							Timestamp:    entry.Timestamp.Unix(),
+							Line:         entry.Line,
+							DroppedCount: dropped,
+						},
+					},
+				}
+				// Only the first entry in the batch needs to carry the
+				// dropped count; zero it out for the rest.
+				dropped = 0
+
+				if err := c.send(msg); err != nil {
+					c.logger.Warn("failed to forward log entry", "error", err)
+					return
+				}
 			}
 		}
 	}
@@ -176,13 +369,13 @@ func (c *Client) receiveMessages() {
 	for {
 		msg, err := c.stream.Recv()
 		if err != nil {
-			log.Printf("Stream receive error: %v", err)
+			c.logger.Warn("stream receive error", "error", err)
 			c.cancel() // Trigger reconnection
 			return
 		}
 
 		if err := c.handleMessage(msg); err != nil {
-			log.Printf("Error handling message: %v", err)
+			c.logger.Error("error handling message", "error", err)
 		}
 	}
 }
@@ -195,93 +388,181 @@ func (c *Client) handleMessage(msg *proto.ServerMessage) error {
 	case *proto.ServerMessage_PushConfig:
 		return c.handlePushConfig(payload.PushConfig)
 	case *proto.ServerMessage_Command:
-		return c.handleCommand(payload.Command)
+		go c.handleCommand(payload.Command)
+		return nil
+	case *proto.ServerMessage_CommandCancel:
+		return c.handleCommandCancel(payload.CommandCancel)
+	case *proto.ServerMessage_TokenRotation:
+		return c.handleTokenRotation(payload.TokenRotation)
 	default:
-		log.Printf("Unknown message type received")
+		c.logger.Warn("unknown message type received")
 	}
 	return nil
 }
 
 // handleRegisterResponse processes registration response
 func (c *Client) handleRegisterResponse(resp *proto.RegisterResponse) error {
-	if resp.Success {
-		log.Printf("Registration successful: %s (Node ID: %d)", resp.Message, resp.NodeId)
-	} else {
+	if !resp.Success {
 		return fmt.Errorf("registration failed: %s", resp.Message)
 	}
+
+	c.logger.Info("registration successful", "message", resp.Message, "node_id", resp.NodeId)
+
+	if resp.RotatedToken != "" {
+		c.logger.Info("received rotated token on register")
+		c.setToken(resp.RotatedToken)
+	}
+
+	return nil
+}
+
+// handleTokenRotation processes a server-initiated token rotation, pushed
+// outside of the register/heartbeat flow so a leaked bootstrap token can be
+// revoked without waiting for the next reconnect.
+func (c *Client) handleTokenRotation(rot *proto.TokenRotation) error {
+	if rot.Token == "" {
+		return fmt.Errorf("received empty rotated token")
+	}
+
+	c.logger.Info("received token rotation")
+	c.setToken(rot.Token)
 	return nil
 }
 
 // handlePushConfig processes configuration push from server
 func (c *Client) handlePushConfig(config *proto.PushConfig) error {
-	log.Printf("Received configuration (version: %d)", config.Version)
+	c.logger.Info("received configuration", "version", config.Version)
 
 	// Update sing-box configuration
 	if err := c.sbManager.UpdateConfig([]byte(config.ConfigJson)); err != nil {
-		log.Printf("Failed to update config: %v", err)
+		c.logger.Error("failed to update config", "error", err)
 		return err
 	}
 
 	// Restart or start sing-box
 	if c.sbManager.IsRunning() {
-		log.Println("Restarting sing-box with new configuration...")
+		c.logger.Info("restarting sing-box with new configuration")
 		if err := c.sbManager.Restart(); err != nil {
-			log.Printf("Failed to restart sing-box: %v", err)
+			c.logger.Error("failed to restart sing-box", "error", err)
 			return err
 		}
 	} else {
-		log.Println("Starting sing-box with new configuration...")
+		c.logger.Info("starting sing-box with new configuration")
 		if err := c.sbManager.Start(); err != nil {
-			log.Printf("Failed to start sing-box: %v", err)
+			c.logger.Error("failed to start sing-box", "error", err)
 			return err
 		}
 	}
 
-	log.Println("Configuration applied successfully")
+	c.logger.Info("configuration applied successfully")
 	return nil
 }
 
-// handleCommand processes remote commands
-func (c *Client) handleCommand(cmd *proto.Command) error {
-	log.Printf("Received command: %s (ID: %s)", cmd.Type, cmd.CommandId)
-
-	var err error
-	var output string
-
-	switch cmd.Type {
-	case "start":
-		err = c.sbManager.Start()
-		output = "Sing-box started"
-	case "stop":
-		err = c.sbManager.Stop()
-		output = "Sing-box stopped"
-	case "restart":
-		err = c.sbManager.Restart()
-		output = "Sing-box restarted"
-	case "status":
-		status := c.sbManager.GetStatus()
-		statusJSON, _ := json.Marshal(status)
-		output = string(statusJSON)
-	default:
-		err = fmt.Errorf("unknown command: %s", cmd.Type)
+// handleCommand dispatches a remote command to its Executor and streams the
+// result back. It runs in its own goroutine so a long-running command (a
+// shell executor tailing logs, say) never blocks receiveMessages from
+// picking up a CommandCancel for it.
+func (c *Client) handleCommand(cmd *proto.Command) {
+	c.logger.Info("received command", "type", cmd.Type, "command_id", cmd.CommandId)
+
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.commandsMu.Lock()
+	c.commands[cmd.CommandId] = cancel
+	c.commandsMu.Unlock()
+
+	defer func() {
+		c.commandsMu.Lock()
+		delete(c.commands, cmd.CommandId)
+		c.commandsMu.Unlock()
+		cancel()
+	}()
+
+	executor, ok := c.executors[cmd.Type]
+	if !ok {
+		c.sendCommandResult(cmd.CommandId, 1, fmt.Errorf("unknown command: %s", cmd.Type))
+		return
 	}
 
-	// Send command result
-	result := &proto.AgentMessage{
-		Payload: &proto.AgentMessage_CommandResult{
-			CommandResult: &proto.CommandResult{
-				CommandId: cmd.CommandId,
-				Success:   err == nil,
-				Output:    output,
+	out := &commandOutputStream{client: c, commandId: cmd.CommandId}
+	exitCode, err := executor.Execute(ctx, cmd, out)
+
+	c.sendCommandResult(cmd.CommandId, exitCode, err)
+}
+
+// handleCommandCancel cancels an in-flight command's context, if it's still
+// running.
+func (c *Client) handleCommandCancel(cancelMsg *proto.CommandCancel) error {
+	c.commandsMu.Lock()
+	cancel, ok := c.commands[cancelMsg.CommandId]
+	c.commandsMu.Unlock()
+
+	if !ok {
+		c.logger.Warn("received cancel for unknown or already-finished command", "command_id", cancelMsg.CommandId)
+		return nil
+	}
+
+	c.logger.Info("cancelling command", "command_id", cancelMsg.CommandId)
+	cancel()
+	return nil
+}
+
+// sendCommandResult sends the terminal CommandResult for a command. It is
+// always sent exactly once per command, even on cancellation or timeout.
+func (c *Client) sendCommandResult(commandId string, exitCode int32, err error) {
+	result := &proto.CommandResult{
+		CommandId: commandId,
+		Success:   err == nil,
+		ExitCode:  exitCode,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	msg := &proto.AgentMessage{
+		Payload: &proto.AgentMessage_CommandResult{CommandResult: result},
+	}
+
+	if sendErr := c.send(msg); sendErr != nil {
+		c.logger.Error("failed to send command result", "command_id", commandId, "error", sendErr)
+	}
+}
+
+// commandOutputStream adapts a single command's output to CommandChunk
+// messages on the agent's stream, tagging each chunk with a monotonically
+// increasing sequence number.
+type commandOutputStream struct {
+	client    *Client
+	commandId string
+	seq       atomic.Int64
+}
+
+func (s *commandOutputStream) Stdout(data []byte) { s.send(proto.CommandChunk_STDOUT, data) }
+func (s *commandOutputStream) Stderr(data []byte) { s.send(proto.CommandChunk_STDERR, data) }
+
+func (s *commandOutputStream) send(stream proto.CommandChunk_Stream, data []byte) {
+	msg := &proto.AgentMessage{
+		Payload: &proto.AgentMessage_CommandChunk{
+			CommandChunk: &proto.CommandChunk{
+				CommandId: s.commandId,
+				Stream:    stream,
+				Data:      data,
+				Seq:       s.seq.Add(1),
 			},
 		},
 	}
 
-	if err != nil {
-		result.GetCommandResult().Error = err.Error()
+	if err := s.client.send(msg); err != nil {
+		s.client.logger.Warn("failed to send command chunk", "command_id", s.commandId, "error", err)
 	}
+}
 
-	return c.stream.Send(result)
+// TriggerReconnect tears down the current connection so Run's reconnect
+// loop re-dials the server, picking up the current server address and TLS
+// material. The token is not re-read from configuration: the reconnect
+// registers with the token the client already holds.
+func (c *Client) TriggerReconnect() {
+	c.cancel()
 }
 
 // Close closes the connection
@@ -300,8 +581,8 @@ func (c *Client) Close() error {
 func (c *Client) Run() {
 	for {
 		if err := c.Connect(); err != nil {
-			log.Printf("Connection failed: %v", err)
-			log.Println("Retrying in 10 seconds...")
+			c.logger.Error("connection failed", "error", err)
+			c.logger.Info("retrying in 10 seconds")
 			time.Sleep(10 * time.Second)
 			continue
 		}
@@ -309,7 +590,7 @@ func (c *Client) Run() {
 		// Wait for disconnection
 		<-c.ctx.Done()
 
-		log.Println("Disconnected. Reconnecting in 5 seconds...")
+		c.logger.Info("disconnected, reconnecting in 5 seconds")
 		time.Sleep(5 * time.Second)
 
 		// Reset context for next connection
@@ -317,6 +598,24 @@ func (c *Client) Run() {
 	}
 }
 
+// convertOutboundStats adapts the singbox package's per-outbound telemetry
+// map into the proto representation sent to the server.
+func convertOutboundStats(stats map[string]clashapi.OutboundStats) map[string]*proto.OutboundStats {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	out := make(map[string]*proto.OutboundStats, len(stats))
+	for tag, s := range stats {
+		out[tag] = &proto.OutboundStats{
+			Upload:          s.Upload,
+			Download:        s.Download,
+			ConnectionCount: int32(s.ConnectionCount),
+		}
+	}
+	return out
+}
+
 // Helper function to extract string field from map
 func getStringField(m map[string]interface{}, key string) string {
 	if val, ok := m[key]; ok {
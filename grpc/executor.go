@@ -0,0 +1,195 @@
+package grpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/seds-net/seds-agent/config"
+	"github.com/seds-net/seds-agent/proto"
+	"github.com/seds-net/seds-agent/singbox"
+)
+
+// outputChunkSize bounds how much output is read from a shell command
+// before being flushed as a CommandChunk.
+const outputChunkSize = 4096
+
+// OutputStream lets an Executor stream command output back to the server as
+// it's produced, instead of buffering the whole thing in memory.
+type OutputStream interface {
+	Stdout(data []byte)
+	Stderr(data []byte)
+}
+
+// Executor runs one command verb to completion (or until ctx is cancelled)
+// and returns its exit code.
+type Executor interface {
+	Execute(ctx context.Context, cmd *proto.Command, out OutputStream) (exitCode int32, err error)
+}
+
+// ExecutorFunc adapts a plain function to the Executor interface.
+type ExecutorFunc func(ctx context.Context, cmd *proto.Command, out OutputStream) (int32, error)
+
+// Execute implements Executor.
+func (f ExecutorFunc) Execute(ctx context.Context, cmd *proto.Command, out OutputStream) (int32, error) {
+	return f(ctx, cmd, out)
+}
+
+// buildExecutors returns the default verb -> Executor table, including the
+// allowlisted shell executor.
+func buildExecutors(sbManager *singbox.Manager) map[string]Executor {
+	return map[string]Executor{
+		"start": ExecutorFunc(func(_ context.Context, _ *proto.Command, out OutputStream) (int32, error) {
+			if err := sbManager.Start(); err != nil {
+				return 1, err
+			}
+			out.Stdout([]byte("Sing-box started"))
+			return 0, nil
+		}),
+		"stop": ExecutorFunc(func(_ context.Context, _ *proto.Command, out OutputStream) (int32, error) {
+			if err := sbManager.Stop(); err != nil {
+				return 1, err
+			}
+			out.Stdout([]byte("Sing-box stopped"))
+			return 0, nil
+		}),
+		"restart": ExecutorFunc(func(_ context.Context, _ *proto.Command, out OutputStream) (int32, error) {
+			if err := sbManager.Restart(); err != nil {
+				return 1, err
+			}
+			out.Stdout([]byte("Sing-box restarted"))
+			return 0, nil
+		}),
+		"status": ExecutorFunc(func(_ context.Context, _ *proto.Command, out OutputStream) (int32, error) {
+			statusJSON, err := json.Marshal(sbManager.GetStatus())
+			if err != nil {
+				return 1, err
+			}
+			out.Stdout(statusJSON)
+			return 0, nil
+		}),
+		"shell": &shellExecutor{},
+	}
+}
+
+// shellExecutor runs an arbitrary command line, gated by
+// config.AllowedCommands glob patterns (e.g. "singbox *", "logs *"). This is
+// the only executor that can run unbounded or long-running diagnostics like
+// `logs -f`.
+type shellExecutor struct{}
+
+// Execute implements Executor.
+func (e *shellExecutor) Execute(ctx context.Context, cmd *proto.Command, out OutputStream) (int32, error) {
+	if !commandAllowed(cmd.Command, config.Get().AllowedCommands) {
+		return 1, fmt.Errorf("command not allowed by config.allowed_commands: %s", cmd.Command)
+	}
+
+	fields := strings.Fields(cmd.Command)
+	if len(fields) == 0 {
+		return 1, fmt.Errorf("empty shell command")
+	}
+
+	c := exec.CommandContext(ctx, fields[0], fields[1:]...)
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return 1, fmt.Errorf("failed to open stdout pipe: %w", err)
+	}
+	stderr, err := c.StderrPipe()
+	if err != nil {
+		return 1, fmt.Errorf("failed to open stderr pipe: %w", err)
+	}
+
+	if err := c.Start(); err != nil {
+		return 1, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan struct{}, 2)
+	go streamPipe(stdout, out.Stdout, done)
+	go streamPipe(stderr, out.Stderr, done)
+	<-done
+	<-done
+
+	err = c.Wait()
+
+	if ctx.Err() == context.Canceled {
+		return -1, fmt.Errorf("command cancelled")
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, fmt.Errorf("command timed out")
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return int32(exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// streamPipe reads r in fixed-size chunks and forwards each one to write,
+// signaling done when the pipe is closed (process exited).
+func streamPipe(r io.Reader, write func([]byte), done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	buf := make([]byte, outputChunkSize)
+	reader := bufio.NewReader(r)
+
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			write(chunk)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// commandAllowed reports whether command matches at least one of the
+// configured glob patterns. Unlike filepath.Match, "*" here matches any
+// sequence of characters including "/", since the commands being allowlisted
+// (e.g. "logs -f /var/log/syslog", "singbox -c /etc/sing-box/config.json")
+// routinely carry path arguments.
+func commandAllowed(command string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether s matches pattern, where "*" matches any
+// sequence of characters (including none) and "?" matches exactly one
+// character. The match is anchored to the whole string.
+func globMatch(pattern, s string) bool {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
@@ -0,0 +1,55 @@
+package grpc
+
+import "testing"
+
+func TestCommandAllowed(t *testing.T) {
+	patterns := []string{"singbox *", "logs *", "status"}
+
+	cases := []struct {
+		command string
+		want    bool
+	}{
+		{command: "singbox restart", want: true},
+		{command: "singbox", want: false},
+		{command: "logs -f", want: true},
+		// Path arguments are the whole point of "logs *"/"singbox *": "*"
+		// must match "/" too, unlike filepath.Match.
+		{command: "logs -f /var/log/syslog", want: true},
+		{command: "singbox -c /etc/sing-box/config.json", want: true},
+		{command: "status", want: true},
+		{command: "rm -rf /", want: false},
+	}
+
+	for _, c := range cases {
+		if got := commandAllowed(c.command, patterns); got != c.want {
+			t.Errorf("commandAllowed(%q, %v) = %v, want %v", c.command, patterns, got, c.want)
+		}
+	}
+}
+
+func TestCommandAllowedNoPatterns(t *testing.T) {
+	if commandAllowed("singbox restart", nil) {
+		t.Error("commandAllowed with no patterns should deny everything")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{pattern: "logs *", s: "logs -f /var/log/syslog", want: true},
+		{pattern: "logs *", s: "logs", want: false}, // "*" requires the space to still be present
+		{pattern: "status", s: "status", want: true},
+		{pattern: "status", s: "status extra", want: false}, // anchored to the whole string
+		{pattern: "node-?", s: "node-1", want: true},
+		{pattern: "node-?", s: "node-12", want: false},
+	}
+
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.s); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
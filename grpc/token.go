@@ -0,0 +1,58 @@
+package grpc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// loadToken reads a previously-rotated token from disk. It returns an empty
+// string (no error) if the file doesn't exist yet, so callers can fall back
+// to the bootstrap token from config.
+func loadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// saveTokenAtomic persists a rotated token to disk, writing to a temp file
+// in the same directory and renaming over the destination so a crash mid
+// write can never leave a truncated or partial token on disk.
+func saveTokenAtomic(path, token string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".token-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp token file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.WriteString(token); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp token file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set token file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to persist rotated token: %w", err)
+	}
+
+	return nil
+}
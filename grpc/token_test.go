@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTokenMissingFile(t *testing.T) {
+	token, err := loadToken(filepath.Join(t.TempDir(), "token"))
+	if err != nil {
+		t.Fatalf("loadToken on missing file: %v", err)
+	}
+	if token != "" {
+		t.Errorf("token = %q, want empty for missing file", token)
+	}
+}
+
+func TestSaveAndLoadTokenRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "token")
+
+	if err := saveTokenAtomic(path, "rotated-token"); err != nil {
+		t.Fatalf("saveTokenAtomic: %v", err)
+	}
+
+	got, err := loadToken(path)
+	if err != nil {
+		t.Fatalf("loadToken: %v", err)
+	}
+	if got != "rotated-token" {
+		t.Errorf("loadToken = %q, want %q", got, "rotated-token")
+	}
+}
+
+func TestSaveTokenAtomicOverwrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+
+	if err := saveTokenAtomic(path, "first"); err != nil {
+		t.Fatalf("saveTokenAtomic(first): %v", err)
+	}
+	if err := saveTokenAtomic(path, "second"); err != nil {
+		t.Fatalf("saveTokenAtomic(second): %v", err)
+	}
+
+	got, err := loadToken(path)
+	if err != nil {
+		t.Fatalf("loadToken: %v", err)
+	}
+	if got != "second" {
+		t.Errorf("loadToken = %q, want %q", got, "second")
+	}
+}
@@ -0,0 +1,65 @@
+// Package logging provides the agent's shared structured logger and a sink
+// that lets captured log lines be forwarded to the control server.
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is a single captured log line, ready to be shipped to the server.
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+}
+
+// Sink is an io.Writer that hclog can write formatted log lines to. It
+// buffers entries in memory for a background forwarder to drain and ship
+// to the server. Under backpressure it drops the oldest buffered entries
+// rather than blocking the logger (and therefore the sing-box monitor or
+// heartbeat goroutines) on a slow or disconnected server.
+type Sink struct {
+	mu      sync.Mutex
+	cap     int
+	entries []Entry
+	dropped uint64
+}
+
+// NewSink creates a Sink that retains at most capacity entries between
+// drains.
+func NewSink(capacity int) *Sink {
+	return &Sink{cap: capacity}
+}
+
+// Write implements io.Writer. It never returns an error and never blocks.
+func (s *Sink) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= s.cap {
+		// Drop-oldest: make room for the new line.
+		copy(s.entries, s.entries[1:])
+		s.entries = s.entries[:len(s.entries)-1]
+		s.dropped++
+	}
+	s.entries = append(s.entries, Entry{Timestamp: time.Now(), Line: string(line)})
+
+	return len(p), nil
+}
+
+// Drain removes and returns all buffered entries along with the number of
+// entries dropped since the last Drain.
+func (s *Sink) Drain() ([]Entry, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.entries
+	s.entries = nil
+	dropped := s.dropped
+	s.dropped = 0
+
+	return entries, dropped
+}
@@ -0,0 +1,78 @@
+package logging
+
+import "testing"
+
+func TestSinkWriteAndDrain(t *testing.T) {
+	s := NewSink(10)
+
+	if _, err := s.Write([]byte("line one")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := s.Write([]byte("line two")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	entries, dropped := s.Drain()
+	if dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Line != "line one" || entries[1].Line != "line two" {
+		t.Errorf("entries = %+v, want [line one, line two] in order", entries)
+	}
+}
+
+func TestSinkDrainResetsBuffer(t *testing.T) {
+	s := NewSink(10)
+	s.Write([]byte("line one"))
+	s.Drain()
+
+	entries, dropped := s.Drain()
+	if len(entries) != 0 || dropped != 0 {
+		t.Errorf("second Drain = (%v, %d), want (empty, 0)", entries, dropped)
+	}
+}
+
+func TestSinkDropsOldestWhenFull(t *testing.T) {
+	s := NewSink(2)
+
+	s.Write([]byte("first"))
+	s.Write([]byte("second"))
+	s.Write([]byte("third")) // should evict "first"
+
+	entries, dropped := s.Drain()
+	if dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Line != "second" || entries[1].Line != "third" {
+		t.Errorf("entries = %+v, want [second, third]", entries)
+	}
+}
+
+func TestSinkDroppedCountAccumulatesAcrossWrites(t *testing.T) {
+	s := NewSink(1)
+
+	s.Write([]byte("first"))
+	s.Write([]byte("second")) // drops "first"
+	s.Write([]byte("third"))  // drops "second"
+
+	entries, dropped := s.Drain()
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+	if len(entries) != 1 || entries[0].Line != "third" {
+		t.Errorf("entries = %+v, want [third]", entries)
+	}
+
+	// dropped count resets after Drain.
+	s.Write([]byte("fourth"))
+	_, dropped = s.Drain()
+	if dropped != 0 {
+		t.Errorf("dropped after reset = %d, want 0", dropped)
+	}
+}
@@ -0,0 +1,115 @@
+// Package clashapi is a thin client for the Clash-compatible HTTP API that
+// sing-box exposes when experimental.clash_api is configured. It is used to
+// pull traffic and connection telemetry without parsing sing-box's own logs.
+package clashapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Client talks to a single sing-box instance's Clash API.
+type Client struct {
+	baseURL    string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewClient creates a Client for the given external_controller address
+// (host:port, no scheme) and optional secret.
+func NewClient(externalController, secret string) *Client {
+	return &Client{
+		baseURL: "http://" + externalController,
+		secret:  secret,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Traffic is one sample read from /traffic (up/down bytes per second).
+type Traffic struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// Memory is one sample read from /memory.
+type Memory struct {
+	InUse   int64 `json:"inuse"`
+	OSLimit int64 `json:"oslimit"`
+}
+
+// Connection describes a single active connection as reported by
+// /connections.
+type Connection struct {
+	ID       string            `json:"id"`
+	Upload   int64             `json:"upload"`
+	Download int64             `json:"download"`
+	Start    time.Time         `json:"start"`
+	Chains   []string          `json:"chains"`
+	Rule     string            `json:"rule"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ConnectionsSnapshot is the decoded body of /connections.
+type ConnectionsSnapshot struct {
+	DownloadTotal int64        `json:"downloadTotal"`
+	UploadTotal   int64        `json:"uploadTotal"`
+	Connections   []Connection `json:"connections"`
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if c.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request %s: unexpected status %d", path, resp.StatusCode)
+	}
+
+	// /traffic and /connections are technically push streams, but sing-box
+	// flushes one JSON object per chunked write, so a single decode gives us
+	// a point-in-time sample.
+	dec := json.NewDecoder(resp.Body)
+	return dec.Decode(out)
+}
+
+// Traffic fetches one up/down sample from /traffic.
+func (c *Client) Traffic(ctx context.Context) (*Traffic, error) {
+	var t Traffic
+	if err := c.get(ctx, "/traffic", &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Memory fetches one sample from /memory.
+func (c *Client) Memory(ctx context.Context) (*Memory, error) {
+	var m Memory
+	if err := c.get(ctx, "/memory", &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Connections fetches the current connection list from /connections.
+func (c *Client) Connections(ctx context.Context) (*ConnectionsSnapshot, error) {
+	var s ConnectionsSnapshot
+	if err := c.get(ctx, "/connections", &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,200 @@
+package clashapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// OutboundStats is the rolling traffic/connection total attributed to a
+// single outbound tag.
+type OutboundStats struct {
+	Upload          int64 `json:"upload"`
+	Download        int64 `json:"download"`
+	ConnectionCount int   `json:"connection_count"`
+}
+
+// Snapshot is the latest rolling telemetry the Poller has collected.
+type Snapshot struct {
+	UploadTotal       int64
+	DownloadTotal     int64
+	ActiveConnections int
+	PerOutbound       map[string]OutboundStats
+	// PerRule is keyed by the matching Clash rule (e.g. "DOMAIN-SUFFIX,
+	// example.com,Proxy"), or "unmatched" for connections with no rule, so
+	// the server can show which rules are actually carrying traffic.
+	PerRule map[string]OutboundStats
+
+	// UploadRate and DownloadRate are the most recent instantaneous
+	// bytes/sec sample from /traffic.
+	UploadRate   int64
+	DownloadRate int64
+
+	// MemoryInUse is the most recent sample from /memory.
+	MemoryInUse int64
+}
+
+// Poller periodically samples a sing-box Clash API and maintains rolling
+// counters. It is safe for concurrent use.
+type Poller struct {
+	client   *Client
+	interval time.Duration
+	logger   hclog.Logger
+
+	mu       sync.RWMutex
+	snapshot Snapshot
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPoller creates a Poller that samples client every interval once
+// started.
+func NewPoller(client *Client, interval time.Duration, logger hclog.Logger) *Poller {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	return &Poller{
+		client:   client,
+		interval: interval,
+		logger:   logger,
+		snapshot: Snapshot{PerOutbound: map[string]OutboundStats{}, PerRule: map[string]OutboundStats{}},
+	}
+}
+
+// Start begins polling in the background. It returns immediately; call Stop
+// to end polling. Start must not be called again before Stop.
+func (p *Poller) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	p.done = make(chan struct{})
+
+	go p.run(ctx)
+}
+
+// Stop ends polling and waits for the background goroutine to exit.
+func (p *Poller) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// Snapshot returns the most recently collected telemetry.
+func (p *Poller) Snapshot() Snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	perOutbound := make(map[string]OutboundStats, len(p.snapshot.PerOutbound))
+	for k, v := range p.snapshot.PerOutbound {
+		perOutbound[k] = v
+	}
+	perRule := make(map[string]OutboundStats, len(p.snapshot.PerRule))
+	for k, v := range p.snapshot.PerRule {
+		perRule[k] = v
+	}
+
+	return Snapshot{
+		UploadTotal:       p.snapshot.UploadTotal,
+		DownloadTotal:     p.snapshot.DownloadTotal,
+		ActiveConnections: p.snapshot.ActiveConnections,
+		PerOutbound:       perOutbound,
+		PerRule:           perRule,
+		UploadRate:        p.snapshot.UploadRate,
+		DownloadRate:      p.snapshot.DownloadRate,
+		MemoryInUse:       p.snapshot.MemoryInUse,
+	}
+}
+
+func (p *Poller) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll(ctx)
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context) {
+	conns, err := p.client.Connections(ctx)
+	if err != nil {
+		p.logger.Warn("failed to poll /connections", "error", err)
+		return
+	}
+
+	perOutbound, perRule := aggregateConnections(conns.Connections)
+
+	// /traffic and /memory are sampled best-effort: a failure to reach
+	// either one shouldn't drop the connections-derived telemetry above.
+	var uploadRate, downloadRate, memInUse int64
+	if traffic, err := p.client.Traffic(ctx); err != nil {
+		p.logger.Warn("failed to poll /traffic", "error", err)
+	} else {
+		uploadRate = traffic.Up
+		downloadRate = traffic.Down
+	}
+	if mem, err := p.client.Memory(ctx); err != nil {
+		p.logger.Warn("failed to poll /memory", "error", err)
+	} else {
+		memInUse = mem.InUse
+	}
+
+	p.mu.Lock()
+	p.snapshot = Snapshot{
+		UploadTotal:       conns.UploadTotal,
+		DownloadTotal:     conns.DownloadTotal,
+		ActiveConnections: len(conns.Connections),
+		PerOutbound:       perOutbound,
+		PerRule:           perRule,
+		UploadRate:        uploadRate,
+		DownloadRate:      downloadRate,
+		MemoryInUse:       memInUse,
+	}
+	p.mu.Unlock()
+}
+
+// unmatchedRule is the PerRule key used for connections with no matching
+// Clash rule reported.
+const unmatchedRule = "unmatched"
+
+// aggregateConnections buckets conns by outbound tag (the last hop of each
+// connection's Chains) and by matching rule, summing upload/download bytes
+// and counting connections in each bucket.
+func aggregateConnections(conns []Connection) (perOutbound, perRule map[string]OutboundStats) {
+	perOutbound = make(map[string]OutboundStats, len(conns))
+	perRule = make(map[string]OutboundStats, len(conns))
+
+	for _, c := range conns {
+		outboundTag := "direct"
+		if len(c.Chains) > 0 {
+			outboundTag = c.Chains[len(c.Chains)-1]
+		}
+		ruleTag := c.Rule
+		if ruleTag == "" {
+			ruleTag = unmatchedRule
+		}
+
+		addConnectionStats(perOutbound, outboundTag, c)
+		addConnectionStats(perRule, ruleTag, c)
+	}
+
+	return perOutbound, perRule
+}
+
+func addConnectionStats(m map[string]OutboundStats, key string, c Connection) {
+	stats := m[key]
+	stats.Upload += c.Upload
+	stats.Download += c.Download
+	stats.ConnectionCount++
+	m[key] = stats
+}
@@ -0,0 +1,65 @@
+package clashapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateConnectionsByOutboundTag(t *testing.T) {
+	conns := []Connection{
+		{Upload: 100, Download: 200, Chains: []string{"Proxy", "direct"}},
+		{Upload: 10, Download: 20, Chains: []string{"Proxy", "direct"}},
+		{Upload: 5, Download: 5, Chains: nil},
+	}
+
+	perOutbound, _ := aggregateConnections(conns)
+
+	want := map[string]OutboundStats{
+		"direct": {Upload: 115, Download: 225, ConnectionCount: 3},
+	}
+	if !reflect.DeepEqual(perOutbound, want) {
+		t.Errorf("perOutbound = %+v, want %+v", perOutbound, want)
+	}
+}
+
+func TestAggregateConnectionsByOutboundTagDistinctChains(t *testing.T) {
+	conns := []Connection{
+		{Upload: 100, Download: 200, Chains: []string{"Proxy-A"}},
+		{Upload: 10, Download: 20, Chains: []string{"Proxy-B"}},
+	}
+
+	perOutbound, _ := aggregateConnections(conns)
+
+	want := map[string]OutboundStats{
+		"Proxy-A": {Upload: 100, Download: 200, ConnectionCount: 1},
+		"Proxy-B": {Upload: 10, Download: 20, ConnectionCount: 1},
+	}
+	if !reflect.DeepEqual(perOutbound, want) {
+		t.Errorf("perOutbound = %+v, want %+v", perOutbound, want)
+	}
+}
+
+func TestAggregateConnectionsByRule(t *testing.T) {
+	conns := []Connection{
+		{Upload: 100, Download: 200, Rule: "DOMAIN-SUFFIX,example.com,Proxy"},
+		{Upload: 10, Download: 20, Rule: "DOMAIN-SUFFIX,example.com,Proxy"},
+		{Upload: 5, Download: 5, Rule: ""},
+	}
+
+	_, perRule := aggregateConnections(conns)
+
+	want := map[string]OutboundStats{
+		"DOMAIN-SUFFIX,example.com,Proxy": {Upload: 110, Download: 220, ConnectionCount: 2},
+		unmatchedRule:                     {Upload: 5, Download: 5, ConnectionCount: 1},
+	}
+	if !reflect.DeepEqual(perRule, want) {
+		t.Errorf("perRule = %+v, want %+v", perRule, want)
+	}
+}
+
+func TestAggregateConnectionsEmpty(t *testing.T) {
+	perOutbound, perRule := aggregateConnections(nil)
+	if len(perOutbound) != 0 || len(perRule) != 0 {
+		t.Errorf("expected empty maps, got perOutbound=%+v perRule=%+v", perOutbound, perRule)
+	}
+}
@@ -1,17 +1,90 @@
 package singbox
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/seds-net/seds-agent/singbox/clashapi"
+)
+
+// defaultClashAPIPollInterval is how often the clash API poller samples
+// /connections while sing-box is running, used until SetClashAPIPollInterval
+// is called.
+const defaultClashAPIPollInterval = 2 * time.Second
+
+// State represents the supervised lifecycle of the sing-box process.
+type State int
+
+const (
+	// StateStopped means the process is not running and nothing is scheduled.
+	StateStopped State = iota
+	// StateStarting means Start has been called and the process is spawning.
+	StateStarting
+	// StateRunning means the process is up and past MinRunSeconds is not yet decided.
+	StateRunning
+	// StateBackoff means the process exited early and a restart is scheduled.
+	StateBackoff
+	// StateFatal means MaxRetries consecutive fast exits were hit; no more
+	// automatic restarts will be attempted until Start/Restart is called.
+	StateFatal
+	// StateStopping means Stop has been called and we're waiting for the
+	// process to exit.
+	StateStopping
 )
 
+func (s State) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateBackoff:
+		return "backoff"
+	case StateFatal:
+		return "fatal"
+	case StateStopping:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy configures the restart behavior of the supervisor.
+type Policy struct {
+	// MaxRetries is the number of consecutive fast exits (shorter than
+	// MinRunSeconds) allowed before the manager transitions to StateFatal.
+	MaxRetries int
+	// MinRunSeconds is how long the process must stay up for an exit to be
+	// considered a "healthy" run rather than a fast-crash, resetting the
+	// retry counter.
+	MinRunSeconds int
+	// InitialBackoff is the delay before the first automatic restart.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff delay.
+	MaxBackoff time.Duration
+}
+
+// DefaultPolicy returns the restart policy used when none is supplied.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxRetries:     5,
+		MinRunSeconds:  10,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     60 * time.Second,
+	}
+}
+
 // Manager manages the sing-box subprocess
 type Manager struct {
 	mu          sync.RWMutex
@@ -21,24 +94,91 @@ type Manager struct {
 	running     bool
 	startTime   time.Time
 	lastRestart time.Time
+
+	policy         Policy
+	state          State
+	retryCount     int
+	lastExitReason string
+	backoffTimer   *time.Timer
+	generation     uint64
+
+	clashController   string // host:port of experimental.clash_api.external_controller, empty if disabled
+	clashSecret       string
+	clashPoller       *clashapi.Poller
+	clashCancel       context.CancelFunc
+	clashPollInterval time.Duration
+
+	logger hclog.Logger
+}
+
+// singBoxConfig is the subset of the sing-box config JSON we need to read
+// back out after writing it, to know how to reach the Clash API.
+type singBoxConfig struct {
+	Experimental struct {
+		ClashAPI *struct {
+			ExternalController string `json:"external_controller"`
+			Secret             string `json:"secret"`
+		} `json:"clash_api"`
+	} `json:"experimental"`
 }
 
 // Status represents sing-box status
 type Status struct {
-	Running   bool   `json:"running"`
-	Version   string `json:"version"`
-	Uptime    int64  `json:"uptime"`
-	StartTime int64  `json:"start_time"`
+	Running        bool   `json:"running"`
+	Version        string `json:"version"`
+	Uptime         int64  `json:"uptime"`
+	StartTime      int64  `json:"start_time"`
+	State          string `json:"state"`
+	RetryCount     int    `json:"retry_count"`
+	LastExitReason string `json:"last_exit_reason,omitempty"`
+
+	Connections int64                             `json:"connections"`
+	Upload      int64                             `json:"upload"`
+	Download    int64                             `json:"download"`
+	PerOutbound map[string]clashapi.OutboundStats `json:"per_outbound,omitempty"`
+	PerRule     map[string]clashapi.OutboundStats `json:"per_rule,omitempty"`
 }
 
 // NewManager creates a new sing-box manager
-func NewManager(execPath, configDir string) *Manager {
+func NewManager(execPath, configDir string, logger hclog.Logger) *Manager {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
 	return &Manager{
-		execPath:   execPath,
-		configPath: filepath.Join(configDir, "config.json"),
+		execPath:          execPath,
+		configPath:        filepath.Join(configDir, "config.json"),
+		policy:            DefaultPolicy(),
+		state:             StateStopped,
+		logger:            logger,
+		clashPollInterval: defaultClashAPIPollInterval,
 	}
 }
 
+// SetPolicy overrides the default restart policy. It must be called before
+// Start to take effect for the first launch.
+func (m *Manager) SetPolicy(p Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = p
+}
+
+// SetExecPath changes the sing-box executable path used by future
+// Start/Restart calls. It does not affect an already-running process; the
+// caller (the config watcher) is expected to follow up with Restart.
+func (m *Manager) SetExecPath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.execPath = path
+}
+
+// SetClashAPIPollInterval changes how often the Clash API poller samples
+// telemetry. It takes effect the next time the poller is (re)started.
+func (m *Manager) SetClashAPIPollInterval(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clashPollInterval = d
+}
+
 // UpdateConfig writes new configuration to file
 func (m *Manager) UpdateConfig(config json.RawMessage) error {
 	m.mu.Lock()
@@ -54,24 +194,51 @@ func (m *Manager) UpdateConfig(config json.RawMessage) error {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
-	log.Printf("Configuration updated at %s", m.configPath)
+	var parsed singBoxConfig
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		m.logger.Warn("could not parse pushed config to locate clash_api", "error", err)
+		m.clashController = ""
+		m.clashSecret = ""
+	} else if parsed.Experimental.ClashAPI != nil {
+		m.clashController = parsed.Experimental.ClashAPI.ExternalController
+		m.clashSecret = parsed.Experimental.ClashAPI.Secret
+	} else {
+		m.clashController = ""
+		m.clashSecret = ""
+	}
+
+	m.logger.Info("configuration updated", "path", m.configPath)
 	return nil
 }
 
-// Start starts the sing-box process
+// Start starts the sing-box process. Calling Start explicitly clears any
+// Fatal state and resets the retry counter, the same as Restart.
 func (m *Manager) Start() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.startLocked(true)
+}
 
+// startLocked does the actual spawn. resetRetries is true for explicit
+// Start/Restart calls and false for automatic backoff restarts.
+func (m *Manager) startLocked(resetRetries bool) error {
 	if m.running {
 		return fmt.Errorf("sing-box is already running")
 	}
 
+	m.cancelBackoffLocked()
+
 	// Check if config file exists
 	if _, err := os.Stat(m.configPath); os.IsNotExist(err) {
 		return fmt.Errorf("config file not found: %s", m.configPath)
 	}
 
+	if resetRetries {
+		m.retryCount = 0
+	}
+
+	m.state = StateStarting
+
 	// Create command
 	m.cmd = exec.Command(m.execPath, "run", "-c", m.configPath)
 	m.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
@@ -82,30 +249,71 @@ func (m *Manager) Start() error {
 
 	// Start process
 	if err := m.cmd.Start(); err != nil {
+		m.state = StateStopped
 		return fmt.Errorf("failed to start sing-box: %w", err)
 	}
 
 	m.running = true
 	m.startTime = time.Now()
 	m.lastRestart = time.Now()
+	m.state = StateRunning
+	m.generation++
 
-	log.Printf("sing-box started with PID %d", m.cmd.Process.Pid)
+	m.logger.Info("sing-box started", "pid", m.cmd.Process.Pid)
+
+	m.startClashPollerLocked()
 
 	// Monitor process in background
-	go m.monitor()
+	go m.monitor(m.cmd, m.generation)
 
 	return nil
 }
 
+// startClashPollerLocked starts a Clash API poller if the pushed config
+// enabled experimental.clash_api. Callers must hold m.mu. If no clash_api is
+// configured, GetStatus simply keeps reporting zeros.
+func (m *Manager) startClashPollerLocked() {
+	m.stopClashPollerLocked()
+
+	if m.clashController == "" {
+		m.logger.Info("clash_api not configured; traffic/connection telemetry will report zero")
+		return
+	}
+
+	client := clashapi.NewClient(m.clashController, m.clashSecret)
+	poller := clashapi.NewPoller(client, m.clashPollInterval, m.logger.Named("clashapi"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.clashCancel = cancel
+	m.clashPoller = poller
+	poller.Start(ctx)
+}
+
+// stopClashPollerLocked stops any running Clash API poller. Callers must
+// hold m.mu.
+func (m *Manager) stopClashPollerLocked() {
+	if m.clashCancel != nil {
+		m.clashCancel()
+		m.clashCancel = nil
+	}
+	m.clashPoller = nil
+}
+
 // Stop stops the sing-box process
 func (m *Manager) Stop() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// A pending automatic restart must not race with an explicit shutdown.
+	m.cancelBackoffLocked()
+
 	if !m.running || m.cmd == nil || m.cmd.Process == nil {
+		m.state = StateStopped
 		return fmt.Errorf("sing-box is not running")
 	}
 
+	m.state = StateStopping
+
 	// Send SIGTERM
 	if err := m.cmd.Process.Signal(syscall.SIGTERM); err != nil {
 		// If SIGTERM fails, try SIGKILL
@@ -123,7 +331,9 @@ func (m *Manager) Stop() error {
 	select {
 	case <-done:
 		m.running = false
-		log.Println("sing-box stopped")
+		m.state = StateStopped
+		m.stopClashPollerLocked()
+		m.logger.Info("sing-box stopped")
 		return nil
 	case <-time.After(10 * time.Second):
 		// Force kill if not stopped after 10 seconds
@@ -131,7 +341,9 @@ func (m *Manager) Stop() error {
 			return fmt.Errorf("failed to force kill sing-box: %w", err)
 		}
 		m.running = false
-		log.Println("sing-box force killed")
+		m.state = StateStopped
+		m.stopClashPollerLocked()
+		m.logger.Warn("sing-box force killed")
 		return nil
 	}
 }
@@ -139,7 +351,7 @@ func (m *Manager) Stop() error {
 // Restart restarts the sing-box process
 func (m *Manager) Restart() error {
 	if err := m.Stop(); err != nil {
-		log.Printf("Warning: error stopping sing-box: %v", err)
+		m.logger.Warn("error stopping sing-box before restart", "error", err)
 	}
 
 	// Wait a bit before restarting
@@ -154,7 +366,10 @@ func (m *Manager) GetStatus() *Status {
 	defer m.mu.RUnlock()
 
 	status := &Status{
-		Running: m.running,
+		Running:        m.running,
+		State:          m.state.String(),
+		RetryCount:     m.retryCount,
+		LastExitReason: m.lastExitReason,
 	}
 
 	if m.running {
@@ -162,6 +377,15 @@ func (m *Manager) GetStatus() *Status {
 		status.StartTime = m.startTime.Unix()
 	}
 
+	if m.clashPoller != nil {
+		snap := m.clashPoller.Snapshot()
+		status.Connections = int64(snap.ActiveConnections)
+		status.Upload = snap.UploadTotal
+		status.Download = snap.DownloadTotal
+		status.PerOutbound = snap.PerOutbound
+		status.PerRule = snap.PerRule
+	}
+
 	return status
 }
 
@@ -172,21 +396,106 @@ func (m *Manager) IsRunning() bool {
 	return m.running
 }
 
-// monitor monitors the process and marks it as stopped if it exits
-func (m *Manager) monitor() {
-	if m.cmd == nil {
-		return
+// cancelBackoffLocked stops any pending automatic restart timer. Callers
+// must hold m.mu.
+func (m *Manager) cancelBackoffLocked() {
+	if m.backoffTimer != nil {
+		m.backoffTimer.Stop()
+		m.backoffTimer = nil
 	}
+}
 
-	err := m.cmd.Wait()
+// monitor waits for the process to exit and decides whether to restart it,
+// back off, or give up. generation guards against a monitor goroutine from a
+// previous process acting on a manager that has since been stopped/restarted.
+func (m *Manager) monitor(cmd *exec.Cmd, generation uint64) {
+	err := cmd.Wait()
 
 	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.generation != generation {
+		// A newer process has already taken over; this exit is stale.
+		return
+	}
+
+	ranFor := time.Since(m.startTime)
 	m.running = false
-	m.mu.Unlock()
+	m.stopClashPollerLocked()
 
 	if err != nil {
-		log.Printf("sing-box exited with error: %v", err)
+		m.lastExitReason = err.Error()
+		m.logger.Warn("sing-box exited with error", "error", err)
 	} else {
-		log.Println("sing-box exited normally")
+		m.lastExitReason = "exited normally"
+		m.logger.Info("sing-box exited normally")
 	}
+
+	if m.state == StateStopping || m.state == StateStopped {
+		// Explicit Stop() is handling (or already handled) this exit.
+		m.state = StateStopped
+		return
+	}
+
+	if isFastExit(ranFor, m.policy.MinRunSeconds) {
+		m.retryCount++
+	} else {
+		m.retryCount = 0
+	}
+
+	state, backoff := nextRetryDecision(m.policy, m.retryCount)
+	m.state = state
+
+	if state == StateFatal {
+		m.logger.Error("sing-box hit max retries; giving up until explicit Start/Restart", "max_retries", m.policy.MaxRetries)
+		return
+	}
+
+	m.logger.Warn("sing-box restarting after backoff", "backoff", backoff, "attempt", m.retryCount, "max_retries", m.policy.MaxRetries)
+
+	m.backoffTimer = time.AfterFunc(backoff, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.generation != generation || m.running {
+			return
+		}
+		if m.state != StateBackoff {
+			// Stopped or superseded while the timer was pending.
+			return
+		}
+
+		if err := m.startLocked(false); err != nil {
+			m.logger.Error("automatic restart failed", "error", err)
+		}
+	})
+}
+
+// isFastExit reports whether a process that ran for ranFor should count as a
+// crash toward the flap-detection retry counter, rather than a healthy run.
+func isFastExit(ranFor time.Duration, minRunSeconds int) bool {
+	return ranFor < time.Duration(minRunSeconds)*time.Second
+}
+
+// nextRetryDecision decides the post-exit state and, if another automatic
+// restart should be attempted, how long to wait before it. retryCount is the
+// 1-indexed count of consecutive fast exits including the one just handled,
+// so the first fast exit (retryCount == 1) backs off at exactly
+// policy.InitialBackoff. After a healthy run retryCount is 0, which also
+// backs off at policy.InitialBackoff.
+func nextRetryDecision(policy Policy, retryCount int) (state State, backoff time.Duration) {
+	if retryCount >= policy.MaxRetries {
+		return StateFatal, 0
+	}
+
+	attempt := retryCount - 1
+	if attempt < 0 {
+		attempt = 0
+	}
+	backoff = policy.InitialBackoff * time.Duration(1<<uint(attempt))
+	if backoff > policy.MaxBackoff || backoff <= 0 {
+		backoff = policy.MaxBackoff
+	}
+
+	return StateBackoff, backoff
 }
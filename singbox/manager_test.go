@@ -0,0 +1,76 @@
+package singbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsFastExit(t *testing.T) {
+	cases := []struct {
+		ranForSeconds int
+		minRunSeconds int
+		want          bool
+	}{
+		{ranForSeconds: 1, minRunSeconds: 10, want: true},
+		{ranForSeconds: 9, minRunSeconds: 10, want: true},
+		{ranForSeconds: 10, minRunSeconds: 10, want: false},
+		{ranForSeconds: 30, minRunSeconds: 10, want: false},
+	}
+
+	for _, c := range cases {
+		got := isFastExit(time.Duration(c.ranForSeconds)*time.Second, c.minRunSeconds)
+		if got != c.want {
+			t.Errorf("isFastExit(%ds, %d) = %v, want %v", c.ranForSeconds, c.minRunSeconds, got, c.want)
+		}
+	}
+}
+
+func TestNextRetryDecision(t *testing.T) {
+	policy := Policy{
+		MaxRetries:     3,
+		MinRunSeconds:  10,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     60 * time.Second,
+	}
+
+	// The first fast exit must back off at exactly InitialBackoff, not
+	// 2x InitialBackoff.
+	state, backoff := nextRetryDecision(policy, 1)
+	if state != StateBackoff || backoff != policy.InitialBackoff {
+		t.Fatalf("retryCount=1: got (%v, %v), want (%v, %v)", state, backoff, StateBackoff, policy.InitialBackoff)
+	}
+
+	state, backoff = nextRetryDecision(policy, 2)
+	if state != StateBackoff || backoff != 2*policy.InitialBackoff {
+		t.Fatalf("retryCount=2: got (%v, %v), want (%v, %v)", state, backoff, StateBackoff, 2*policy.InitialBackoff)
+	}
+
+	// The MaxRetries-th consecutive fast exit must transition to Fatal,
+	// not allow one more restart.
+	state, _ = nextRetryDecision(policy, policy.MaxRetries)
+	if state != StateFatal {
+		t.Fatalf("retryCount=MaxRetries: got state %v, want %v", state, StateFatal)
+	}
+
+	state, _ = nextRetryDecision(policy, policy.MaxRetries-1)
+	if state != StateBackoff {
+		t.Fatalf("retryCount=MaxRetries-1: got state %v, want %v", state, StateBackoff)
+	}
+}
+
+func TestNextRetryDecisionCapsAtMaxBackoff(t *testing.T) {
+	policy := Policy{
+		MaxRetries:     10,
+		MinRunSeconds:  10,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     5 * time.Second,
+	}
+
+	state, backoff := nextRetryDecision(policy, 5)
+	if state != StateBackoff {
+		t.Fatalf("got state %v, want %v", state, StateBackoff)
+	}
+	if backoff != policy.MaxBackoff {
+		t.Errorf("backoff = %v, want capped at %v", backoff, policy.MaxBackoff)
+	}
+}
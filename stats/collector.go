@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
@@ -55,13 +56,17 @@ type NetworkStats struct {
 
 // Collector collects system statistics
 type Collector struct {
+	logger       hclog.Logger
 	lastNetStats *NetworkStats
 	lastNetTime  time.Time
 }
 
 // NewCollector creates a new stats collector
-func NewCollector() *Collector {
-	return &Collector{}
+func NewCollector(logger hclog.Logger) *Collector {
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	return &Collector{logger: logger}
 }
 
 // Collect collects current system statistics
@@ -76,6 +81,8 @@ func (c *Collector) Collect() (json.RawMessage, error) {
 		stats.Hostname = hostInfo.Hostname
 		stats.Platform = hostInfo.Platform + " " + hostInfo.PlatformVersion
 		stats.Uptime = hostInfo.Uptime
+	} else {
+		c.logger.Warn("failed to collect host info", "error", err)
 	}
 
 	// CPU info
@@ -83,12 +90,16 @@ func (c *Collector) Collect() (json.RawMessage, error) {
 	if err == nil && len(cpuInfo) > 0 {
 		stats.CPU.Model = cpuInfo[0].ModelName
 		stats.CPU.Cores = runtime.NumCPU()
+	} else if err != nil {
+		c.logger.Warn("failed to collect cpu info", "error", err)
 	}
 
 	// CPU usage
 	cpuPercent, err := cpu.Percent(time.Second, false)
 	if err == nil && len(cpuPercent) > 0 {
 		stats.CPU.UsagePercent = cpuPercent[0]
+	} else if err != nil {
+		c.logger.Warn("failed to collect cpu usage", "error", err)
 	}
 
 	// Memory info
@@ -98,6 +109,8 @@ func (c *Collector) Collect() (json.RawMessage, error) {
 		stats.Memory.Used = memInfo.Used
 		stats.Memory.Free = memInfo.Free
 		stats.Memory.UsedPercent = memInfo.UsedPercent
+	} else {
+		c.logger.Warn("failed to collect memory info", "error", err)
 	}
 
 	// Disk info (root partition)
@@ -107,6 +120,8 @@ func (c *Collector) Collect() (json.RawMessage, error) {
 		stats.Disk.Used = diskInfo.Used
 		stats.Disk.Free = diskInfo.Free
 		stats.Disk.UsedPercent = diskInfo.UsedPercent
+	} else {
+		c.logger.Warn("failed to collect disk info", "error", err)
 	}
 
 	// Network info
@@ -114,6 +129,8 @@ func (c *Collector) Collect() (json.RawMessage, error) {
 	if err == nil && len(netIO) > 0 {
 		stats.Network.BytesSent = netIO[0].BytesSent
 		stats.Network.BytesRecv = netIO[0].BytesRecv
+	} else if err != nil {
+		c.logger.Warn("failed to collect network info", "error", err)
 	}
 
 	// Marshal to JSON